@@ -0,0 +1,42 @@
+// Package access provides attribute-based access control for chaincode
+// transactions, gating functions on the "role" attribute issued by Fabric
+// CA on the calling identity's certificate rather than on MSP identity
+// alone.
+package access
+
+import (
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// roleAttributeName is the Fabric CA certificate attribute that carries a
+// client identity's role, e.g. "manufacturer", "excise-officer",
+// "commissioner".
+const roleAttributeName = "role"
+
+// Policy maps a transaction function name to the role required to invoke
+// it. A function with no entry is not gated by this package.
+type Policy map[string]string
+
+// Enforce checks that the identity invoking fn carries the role policy
+// requires, per the Fabric CA "role" attribute on its certificate. It
+// returns nil if fn is not present in policy.
+func Enforce(ctx contractapi.TransactionContextInterface, policy Policy, fn string) error {
+    requiredRole, gated := policy[fn]
+    if !gated {
+        return nil
+    }
+
+    role, ok, err := ctx.GetClientIdentity().GetAttributeValue(roleAttributeName)
+    if err != nil {
+        return &MissingAttributeError{Attribute: roleAttributeName, Cause: err}
+    }
+    if !ok {
+        return &MissingAttributeError{Attribute: roleAttributeName}
+    }
+
+    if role != requiredRole {
+        return &UnauthorizedError{Function: fn, RequiredRole: requiredRole, ActualRole: role}
+    }
+
+    return nil
+}
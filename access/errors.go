@@ -0,0 +1,36 @@
+package access
+
+import "fmt"
+
+// MissingAttributeError is returned when the calling identity's
+// certificate does not carry the attribute a policy requires, so a client
+// SDK can surface an actionable "ask your CA admin to enroll you with
+// attribute X" message instead of a generic authorization failure.
+type MissingAttributeError struct {
+    Attribute string
+    Cause     error
+}
+
+func (e *MissingAttributeError) Error() string {
+    if e.Cause != nil {
+        return fmt.Sprintf("identity is missing required CA attribute %q: %v", e.Attribute, e.Cause)
+    }
+    return fmt.Sprintf("identity is missing required CA attribute %q", e.Attribute)
+}
+
+func (e *MissingAttributeError) Unwrap() error {
+    return e.Cause
+}
+
+// UnauthorizedError is returned when the calling identity carries the
+// required attribute, but with a value that does not grant access to the
+// function it tried to invoke.
+type UnauthorizedError struct {
+    Function     string
+    RequiredRole string
+    ActualRole   string
+}
+
+func (e *UnauthorizedError) Error() string {
+    return fmt.Sprintf("function %s requires role %q, identity has role %q", e.Function, e.RequiredRole, e.ActualRole)
+}
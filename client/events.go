@@ -0,0 +1,26 @@
+// Package client subscribes to the errorcorrectionchaincode's chaincode
+// events over a fabric-gateway connection and forwards them to a pluggable
+// Sink (stdout, Kafka, webhook, ...) so external excise/ERP systems can
+// react to batch corrections in near real time.
+package client
+
+// Event names emitted by the chaincode. These mirror the
+// eventBatchErrorRecorded/eventCorrectionRequested/eventCorrectionApplied
+// constants in errorcorrectionchaincode.go; they are redeclared here
+// because chaincode in package main cannot be imported.
+const (
+    EventBatchErrorRecorded  = "BatchErrorRecorded"
+    EventCorrectionRequested = "CorrectionRequested"
+    EventCorrectionApplied   = "CorrectionApplied"
+)
+
+// Event is a chaincode event forwarded to a Sink, carrying enough
+// transaction metadata for a sink to dedupe or correlate it with other
+// systems.
+type Event struct {
+    Name        string `json:"name"`
+    ChaincodeID string `json:"chaincodeID"`
+    BlockNumber uint64 `json:"blockNumber"`
+    TxID        string `json:"txID"`
+    Payload     []byte `json:"payload"`
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    kafka "github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes each event as a JSON message to a Kafka topic, keyed
+// by batch correlation (the chaincode's transaction ID) so ordered
+// consumers can dedupe retried sends.
+type KafkaSink struct {
+    writer *kafka.Writer
+}
+
+// NewKafkaSink returns a KafkaSink publishing to topic on the given
+// brokers.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+    return &KafkaSink{
+        writer: &kafka.Writer{
+            Addr:     kafka.TCP(brokers...),
+            Topic:    topic,
+            Balancer: &kafka.LeastBytes{},
+        },
+    }
+}
+
+// Send implements Sink.
+func (k *KafkaSink) Send(event Event) error {
+    value, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    err = k.writer.WriteMessages(context.Background(), kafka.Message{
+        Key:   []byte(event.TxID),
+        Value: value,
+    })
+    if err != nil {
+        return fmt.Errorf("failed to write event to kafka. %v", err)
+    }
+
+    return nil
+}
+
+// Close flushes and closes the underlying Kafka writer.
+func (k *KafkaSink) Close() error {
+    return k.writer.Close()
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Listener subscribes to a chaincode's events over a fabric-gateway
+// Network connection and forwards each one to a Sink, checkpointing as it
+// goes so a restart resumes from the last delivered event rather than
+// replaying the whole channel.
+type Listener struct {
+    network       *client.Network
+    chaincodeName string
+    checkpointer  *client.FileCheckpointer
+    sink          Sink
+}
+
+// NewListener returns a Listener that reads chaincodeName's events off
+// network and forwards them to sink. checkpointFile tracks delivery
+// progress across restarts and is created if it does not exist; it must
+// name a file, as an empty name fails to open and NewListener returns an
+// error.
+func NewListener(network *client.Network, chaincodeName string, sink Sink, checkpointFile string) (*Listener, error) {
+    checkpointer, err := client.NewFileCheckpointer(checkpointFile)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open checkpoint file %s. %v", checkpointFile, err)
+    }
+
+    return &Listener{
+        network:       network,
+        chaincodeName: chaincodeName,
+        checkpointer:  checkpointer,
+        sink:          sink,
+    }, nil
+}
+
+// Listen blocks, forwarding chaincode events to the configured Sink until
+// ctx is cancelled or the event channel closes.
+func (l *Listener) Listen(ctx context.Context) error {
+    events, err := l.network.ChaincodeEvents(ctx, l.chaincodeName, client.WithStartBlock(l.checkpointer.BlockNumber()))
+    if err != nil {
+        return fmt.Errorf("failed to subscribe to chaincode events. %v", err)
+    }
+
+    for event := range events {
+        sinkEvent := Event{
+            Name:        event.EventName,
+            ChaincodeID: event.ChaincodeName,
+            BlockNumber: event.BlockNumber,
+            TxID:        event.TransactionID,
+            Payload:     event.Payload,
+        }
+
+        if err := l.sink.Send(sinkEvent); err != nil {
+            return fmt.Errorf("sink failed to handle event %s (tx %s). %v", sinkEvent.Name, sinkEvent.TxID, err)
+        }
+
+        if err := l.checkpointer.CheckpointChaincodeEvent(event); err != nil {
+            return fmt.Errorf("failed to checkpoint event %s (tx %s). %v", sinkEvent.Name, sinkEvent.TxID, err)
+        }
+    }
+
+    return ctx.Err()
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "bytes"
+)
+
+// Sink receives chaincode events forwarded by a Listener. Implementations
+// must be safe to call repeatedly with the same event: a Listener
+// re-delivers the event still under checkpoint on restart.
+type Sink interface {
+    Send(event Event) error
+}
+
+// StdoutSink logs events to stdout. Useful for local development and as the
+// default sink when no downstream system is configured.
+type StdoutSink struct{}
+
+// Send implements Sink.
+func (StdoutSink) Send(event Event) error {
+    log.Printf("chaincode event %s (tx %s, block %d): %s", event.Name, event.TxID, event.BlockNumber, string(event.Payload))
+    return nil
+}
+
+// WebhookSink POSTs each event as JSON to a configured URL.
+type WebhookSink struct {
+    URL        string
+    HTTPClient *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink posting to url with a default HTTP
+// client.
+func NewWebhookSink(url string) *WebhookSink {
+    return &WebhookSink{URL: url, HTTPClient: http.DefaultClient}
+}
+
+// Send implements Sink.
+func (w *WebhookSink) Send(event Event) error {
+    body, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+
+    resp, err := w.HTTPClient.Post(w.URL, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return fmt.Errorf("failed to post event to webhook. %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+    }
+
+    return nil
+}
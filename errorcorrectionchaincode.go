@@ -1,17 +1,92 @@
 package main
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
     "fmt"
     "encoding/json"
 
+    "github.com/balu6914/IEMS2.0/access"
+    "github.com/hyperledger/fabric-chaincode-go/shim"
     "github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// accessPolicy declares which Fabric CA "role" attribute each gated
+// transaction requires. Functions with no entry here are not restricted by
+// the access package.
+var accessPolicy = access.Policy{
+    "RecordError":         "manufacturer",
+    "RequestCorrection":   "excise-officer",
+    "CorrectError":        "commissioner",
+    "MintSerials":         "manufacturer",
+    "TransferSerialRange": "distributor",
+}
+
+// regulatorCollection is the private data collection (see
+// collections_config.json) that only the excise-department org can read.
+const regulatorCollection = "regulatorCollection"
+
+// regulatorCollectionMSPID is the MSP allowed to read approval letters out
+// of regulatorCollection.
+const regulatorCollectionMSPID = "ExciseDeptMSP"
+
+// CorrectionStatus is the state of an ErrorCorrectionRequest as it moves
+// through the endorsement workflow.
+type CorrectionStatus string
+
+const (
+    StatusRequested CorrectionStatus = "Requested"
+    StatusEndorsed  CorrectionStatus = "Endorsed"
+    StatusApproved  CorrectionStatus = "Approved"
+    StatusApplied   CorrectionStatus = "Applied"
+    StatusRejected  CorrectionStatus = "Rejected"
+)
+
+// endorserMSPID is the org that must countersign a correction request
+// before the approver orgs vote on it.
+const endorserMSPID = "ExciseDeptMSP"
+
+// approverMSPIDs are the orgs whose vote counts toward the approval
+// threshold for CorrectError.
+var approverMSPIDs = []string{"ExciseDeptMSP", "CommissionerMSP"}
+
+// approvalThreshold is the number of distinct approver MSPs that must call
+// ApproveCorrection before CorrectError is allowed to apply the change.
+const approvalThreshold = 2
+
+// AuditEntry records a single identity-attributed step of the correction
+// workflow for a batch.
+type AuditEntry struct {
+    MSPID     string `json:"mspID"`
+    Identity  string `json:"identity"`
+    Action    string `json:"action"`
+    TxID      string `json:"txID"`
+    Timestamp string `json:"timestamp"`
+}
+
 // SmartContract provides functions for managing alcohol manufacturing data
 type SmartContract struct {
     contractapi.Contract
 }
 
+// enforceAccessPolicy enforces accessPolicy against the calling identity's
+// Fabric CA "role" attribute, so the attribute-gated functions themselves
+// don't need to repeat the check. It is wired up as contractapi's
+// before-transaction hook in main by assigning it to the embedded
+// contractapi.Contract's BeforeTransaction field — a method on
+// SmartContract named BeforeTransaction would only shadow that field, not
+// populate it, and contractapi would never call it.
+func (s *SmartContract) enforceAccessPolicy(ctx contractapi.TransactionContextInterface) error {
+    fn, _ := ctx.GetStub().GetFunctionAndParameters()
+    // A function may be invoked by its contract-qualified name
+    // ("SmartContract:RecordError"); look it up by its bare name.
+    if i := strings.LastIndex(fn, ":"); i >= 0 {
+        fn = fn[i+1:]
+    }
+    return access.Enforce(ctx, accessPolicy, fn)
+}
+
 // BottleData represents the data structure for each batch of bottles
 type BottleData struct {
     BatchID     string `json:"batchID"`
@@ -21,13 +96,125 @@ type BottleData struct {
     ErrorDetails string `json:"errorDetails"`
 }
 
-// ErrorCorrectionRequest represents a request to correct an error
+// bottleKeyObjectType namespaces the composite keys used to track
+// individual serialized bottles, keeping them out of the batch-level key
+// space used by BottleData/ErrorCorrectionRequest.
+const bottleKeyObjectType = "bottle"
+
+// serialIndexPrefix maps a global serial number to the batch it was minted
+// into, so GetBottleProvenance can find a bottle's composite key without
+// the caller having to already know its batch.
+const serialIndexPrefix = "SERIAL_"
+
+// serialDigits is the zero-padded width used when formatting a serial
+// number, so composite keys for a batch sort and range-scan in numeric
+// order.
+const serialDigits = 12
+
+// Bottle represents a single serialized unit (GS1 SGTIN) minted out of a
+// batch, tracked independently of the batch's aggregate Quantity so it can
+// be traced and transferred unit by unit.
+type Bottle struct {
+    BatchID string `json:"batchID"`
+    Serial  string `json:"serial"`
+    // Owner is the client identity ID (GetClientIdentity().GetID()) that
+    // currently holds this bottle, empty until the first
+    // TransferSerialRange out of the manufacturer's custody.
+    Owner string `json:"owner"`
+}
+
+// BottleHistoryQueryResult wraps a single entry returned by
+// GetBottleProvenance.
+type BottleHistoryQueryResult struct {
+    Record    *Bottle `json:"record"`
+    TxId      string  `json:"txId"`
+    Timestamp string  `json:"timestamp"`
+    IsDelete  bool    `json:"isDelete"`
+}
+
+// ErrorCorrectionRequest represents a request to correct an error. The
+// approval letter itself is not stored here: it lives in the
+// regulatorCollection private data collection, and only its hash is kept
+// on-chain so every peer can still validate a correction without being
+// able to read the letter.
 type ErrorCorrectionRequest struct {
+    BatchID            string           `json:"batchID"`
+    IncorrectBrand     string           `json:"incorrectBrand"`
+    CorrectBrand       string           `json:"correctBrand"`
+    ApprovedBy         string           `json:"approvedBy"`
+    ApprovalLetterHash string           `json:"approvalLetterHash"`
+    Status             CorrectionStatus `json:"status"`
+    Approvals          []string         `json:"approvals"`
+    AuditTrail         []AuditEntry     `json:"auditTrail"`
+}
+
+// approvalLetterPrivateDetails is the payload written to regulatorCollection.
+type approvalLetterPrivateDetails struct {
+    BatchID        string `json:"batchID"`
+    ApprovalLetter string `json:"approvalLetter"`
+}
+
+// HistoryQueryResult wraps a single entry returned by GetBatchHistory
+type HistoryQueryResult struct {
+    Record    *BottleData `json:"record"`
+    TxId      string      `json:"txId"`
+    Timestamp string      `json:"timestamp"`
+    IsDelete  bool        `json:"isDelete"`
+}
+
+// PaginatedQueryResult wraps a page of query results along with the
+// bookmark needed to fetch the next page
+type PaginatedQueryResult struct {
+    Records             []*BottleData `json:"records"`
+    FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+    Bookmark            string        `json:"bookmark"`
+}
+
+// Chaincode event names emitted for downstream ERP/analytics integration.
+// External systems subscribe to these via the client package's event
+// listener rather than polling the ledger.
+const (
+    eventBatchErrorRecorded = "BatchErrorRecorded"
+    eventCorrectionRequested = "CorrectionRequested"
+    eventCorrectionApplied   = "CorrectionApplied"
+)
+
+// BatchErrorRecordedEvent is the payload emitted when RecordError flags a
+// batch.
+type BatchErrorRecordedEvent struct {
+    BatchID      string `json:"batchID"`
+    BrandCode    string `json:"brandCode"`
+    ErrorDetails string `json:"errorDetails"`
+    TxID         string `json:"txID"`
+}
+
+// CorrectionRequestedEvent is the payload emitted when RequestCorrection
+// opens a new correction workflow for a batch.
+type CorrectionRequestedEvent struct {
     BatchID        string `json:"batchID"`
     IncorrectBrand string `json:"incorrectBrand"`
     CorrectBrand   string `json:"correctBrand"`
-    ApprovedBy     string `json:"approvedBy"`
-    ApprovalLetter string `json:"approvalLetter"`
+    TxID           string `json:"txID"`
+}
+
+// CorrectionAppliedEvent is the payload emitted once CorrectError has
+// written the corrected brand code back to the batch.
+type CorrectionAppliedEvent struct {
+    BatchID   string `json:"batchID"`
+    BrandCode string `json:"brandCode"`
+    TxID      string `json:"txID"`
+}
+
+// setEvent marshals payload and sets it as a chaincode event. Failures here
+// surface as a transaction error: an ERP integration that silently misses
+// an event is worse than a transaction that never committed.
+func setEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+    payloadJSON, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    return ctx.GetStub().SetEvent(name, payloadJSON)
 }
 
 // InitLedger adds a base set of data to the ledger
@@ -75,43 +262,222 @@ func (s *SmartContract) RecordError(ctx contractapi.TransactionContextInterface,
         return err
     }
 
-    return ctx.GetStub().PutState(batchID, updatedBottleJSON)
+    if err := ctx.GetStub().PutState(batchID, updatedBottleJSON); err != nil {
+        return fmt.Errorf("failed to put to world state. %v", err)
+    }
+
+    return setEvent(ctx, eventBatchErrorRecorded, BatchErrorRecordedEvent{
+        BatchID:      bottle.BatchID,
+        BrandCode:    bottle.BrandCode,
+        ErrorDetails: bottle.ErrorDetails,
+        TxID:         ctx.GetStub().GetTxID(),
+    })
 }
 
-// RequestCorrection records a request for error correction
-func (s *SmartContract) RequestCorrection(ctx contractapi.TransactionContextInterface, batchID string, incorrectBrand string, correctBrand string, approvedBy string, approvalLetter string) error {
+// RequestCorrection records a request for error correction. The approval
+// letter is supplied via the transaction's transient map (key
+// "approval_letter") rather than as a regular argument, so it is never
+// written to the public ledger or included in transaction proposals/events.
+// It is stored in the regulatorCollection private data collection, and only
+// its SHA-256 hash is kept in the public ErrorCorrectionRequest.
+func (s *SmartContract) RequestCorrection(ctx contractapi.TransactionContextInterface, batchID string, incorrectBrand string, correctBrand string, approvedBy string) error {
+    transientMap, err := ctx.GetStub().GetTransient()
+    if err != nil {
+        return fmt.Errorf("failed to read transient data. %v", err)
+    }
+
+    approvalLetter, ok := transientMap["approval_letter"]
+    if !ok {
+        return fmt.Errorf("approval_letter must be supplied via the transient map")
+    }
+
+    hash := sha256.Sum256(approvalLetter)
+
+    auditEntry, err := newAuditEntry(ctx, "Requested")
+    if err != nil {
+        return err
+    }
+
     correctionRequest := ErrorCorrectionRequest{
+        BatchID:            batchID,
+        IncorrectBrand:     incorrectBrand,
+        CorrectBrand:       correctBrand,
+        ApprovedBy:         approvedBy,
+        ApprovalLetterHash: hex.EncodeToString(hash[:]),
+        Status:             StatusRequested,
+        AuditTrail:         []AuditEntry{auditEntry},
+    }
+
+    correctionRequestJSON, err := json.Marshal(correctionRequest)
+    if err != nil {
+        return err
+    }
+
+    if err := ctx.GetStub().PutState("CORRECTION_"+batchID, correctionRequestJSON); err != nil {
+        return fmt.Errorf("failed to put to world state. %v", err)
+    }
+
+    privateDetails := approvalLetterPrivateDetails{
+        BatchID:        batchID,
+        ApprovalLetter: string(approvalLetter),
+    }
+    privateDetailsJSON, err := json.Marshal(privateDetails)
+    if err != nil {
+        return err
+    }
+
+    if err := ctx.GetStub().PutPrivateData(regulatorCollection, batchID, privateDetailsJSON); err != nil {
+        return fmt.Errorf("failed to put to regulatorCollection. %v", err)
+    }
+
+    return setEvent(ctx, eventCorrectionRequested, CorrectionRequestedEvent{
         BatchID:        batchID,
         IncorrectBrand: incorrectBrand,
         CorrectBrand:   correctBrand,
-        ApprovedBy:     approvedBy,
-        ApprovalLetter: approvalLetter,
+        TxID:           ctx.GetStub().GetTxID(),
+    })
+}
+
+// GetApprovalLetter returns the approval letter for a batch's correction
+// request out of the regulatorCollection private data collection. Only the
+// excise department's org can read it; every other org's peer will reject
+// the request before the private data is even accessed.
+func (s *SmartContract) GetApprovalLetter(ctx contractapi.TransactionContextInterface, batchID string) (string, error) {
+    clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return "", fmt.Errorf("failed to get client MSP ID. %v", err)
+    }
+    if clientMSPID != regulatorCollectionMSPID {
+        return "", fmt.Errorf("client from org %s is not authorized to read approval letters", clientMSPID)
     }
 
-    correctionRequestJSON, err := json.Marshal(correctionRequest)
+    privateDetailsJSON, err := ctx.GetStub().GetPrivateData(regulatorCollection, batchID)
+    if err != nil {
+        return "", fmt.Errorf("failed to read from regulatorCollection. %v", err)
+    }
+    if privateDetailsJSON == nil {
+        return "", fmt.Errorf("no approval letter found for batch %s", batchID)
+    }
+
+    var privateDetails approvalLetterPrivateDetails
+    if err := json.Unmarshal(privateDetailsJSON, &privateDetails); err != nil {
+        return "", err
+    }
+
+    return privateDetails.ApprovalLetter, nil
+}
+
+// EndorseCorrection countersigns a requested correction. Only endorserMSPID
+// may call this, and it must be the next step after RequestCorrection.
+func (s *SmartContract) EndorseCorrection(ctx contractapi.TransactionContextInterface, batchID string) error {
+    correctionRequest, err := getCorrectionRequest(ctx, batchID)
+    if err != nil {
+        return err
+    }
+
+    clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return fmt.Errorf("failed to get client MSP ID. %v", err)
+    }
+    if clientMSPID != endorserMSPID {
+        return fmt.Errorf("org %s is not permitted to endorse corrections", clientMSPID)
+    }
+    if correctionRequest.Status != StatusRequested {
+        return fmt.Errorf("correction request for batch %s is %s, not %s", batchID, correctionRequest.Status, StatusRequested)
+    }
+
+    auditEntry, err := newAuditEntry(ctx, "Endorsed")
     if err != nil {
         return err
     }
 
-    return ctx.GetStub().PutState("CORRECTION_"+batchID, correctionRequestJSON)
+    correctionRequest.Status = StatusEndorsed
+    correctionRequest.AuditTrail = append(correctionRequest.AuditTrail, auditEntry)
+
+    return putCorrectionRequest(ctx, correctionRequest)
 }
 
-// CorrectError corrects the error in a batch upon approval
-func (s *SmartContract) CorrectError(ctx contractapi.TransactionContextInterface, batchID string) error {
-    correctionRequestJSON, err := ctx.GetStub().GetState("CORRECTION_" + batchID)
+// ApproveCorrection records an approver org's vote for a correction. Once
+// approvalThreshold distinct approver MSPs have voted, the request moves to
+// StatusApproved and CorrectError may be called.
+func (s *SmartContract) ApproveCorrection(ctx contractapi.TransactionContextInterface, batchID string) error {
+    correctionRequest, err := getCorrectionRequest(ctx, batchID)
     if err != nil {
-        return fmt.Errorf("failed to read from world state. %v", err)
+        return err
     }
-    if correctionRequestJSON == nil {
-        return fmt.Errorf("correction request for batch %s does not exist", batchID)
+
+    clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return fmt.Errorf("failed to get client MSP ID. %v", err)
+    }
+    if !isApproverMSP(clientMSPID) {
+        return fmt.Errorf("org %s is not permitted to approve corrections", clientMSPID)
+    }
+    if correctionRequest.Status != StatusEndorsed && correctionRequest.Status != StatusApproved {
+        return fmt.Errorf("correction request for batch %s is %s, not %s", batchID, correctionRequest.Status, StatusEndorsed)
     }
 
-    var correctionRequest ErrorCorrectionRequest
-    err = json.Unmarshal(correctionRequestJSON, &correctionRequest)
+    for _, approver := range correctionRequest.Approvals {
+        if approver == clientMSPID {
+            return fmt.Errorf("org %s has already approved this correction", clientMSPID)
+        }
+    }
+
+    auditEntry, err := newAuditEntry(ctx, "Approved")
+    if err != nil {
+        return err
+    }
+
+    correctionRequest.Approvals = append(correctionRequest.Approvals, clientMSPID)
+    correctionRequest.AuditTrail = append(correctionRequest.AuditTrail, auditEntry)
+    if len(correctionRequest.Approvals) >= approvalThreshold {
+        correctionRequest.Status = StatusApproved
+    }
+
+    return putCorrectionRequest(ctx, correctionRequest)
+}
+
+// RejectCorrection lets an endorser or approver org stop a correction
+// request at any point before it is applied.
+func (s *SmartContract) RejectCorrection(ctx contractapi.TransactionContextInterface, batchID string, reason string) error {
+    correctionRequest, err := getCorrectionRequest(ctx, batchID)
     if err != nil {
         return err
     }
 
+    clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return fmt.Errorf("failed to get client MSP ID. %v", err)
+    }
+    if clientMSPID != endorserMSPID && !isApproverMSP(clientMSPID) {
+        return fmt.Errorf("org %s is not permitted to reject corrections", clientMSPID)
+    }
+    if correctionRequest.Status == StatusApplied || correctionRequest.Status == StatusRejected {
+        return fmt.Errorf("correction request for batch %s is already %s", batchID, correctionRequest.Status)
+    }
+
+    auditEntry, err := newAuditEntry(ctx, "Rejected: "+reason)
+    if err != nil {
+        return err
+    }
+
+    correctionRequest.Status = StatusRejected
+    correctionRequest.AuditTrail = append(correctionRequest.AuditTrail, auditEntry)
+
+    return putCorrectionRequest(ctx, correctionRequest)
+}
+
+// CorrectError applies a correction once it has reached StatusApproved,
+// i.e. once approvalThreshold approver MSPs have signed off.
+func (s *SmartContract) CorrectError(ctx contractapi.TransactionContextInterface, batchID string) error {
+    correctionRequest, err := getCorrectionRequest(ctx, batchID)
+    if err != nil {
+        return err
+    }
+    if correctionRequest.Status != StatusApproved {
+        return fmt.Errorf("correction request for batch %s is %s, needs %d approvals to reach %s", batchID, correctionRequest.Status, approvalThreshold, StatusApproved)
+    }
+
     bottleJSON, err := ctx.GetStub().GetState(batchID)
     if err != nil {
         return fmt.Errorf("failed to read from world state. %v", err)
@@ -136,11 +502,430 @@ func (s *SmartContract) CorrectError(ctx contractapi.TransactionContextInterface
         return err
     }
 
-    return ctx.GetStub().PutState(batchID, updatedBottleJSON)
+    if err := ctx.GetStub().PutState(batchID, updatedBottleJSON); err != nil {
+        return fmt.Errorf("failed to put to world state. %v", err)
+    }
+
+    auditEntry, err := newAuditEntry(ctx, "Applied")
+    if err != nil {
+        return err
+    }
+    correctionRequest.Status = StatusApplied
+    correctionRequest.AuditTrail = append(correctionRequest.AuditTrail, auditEntry)
+
+    if err := putCorrectionRequest(ctx, correctionRequest); err != nil {
+        return err
+    }
+
+    return setEvent(ctx, eventCorrectionApplied, CorrectionAppliedEvent{
+        BatchID:   bottle.BatchID,
+        BrandCode: bottle.BrandCode,
+        TxID:      ctx.GetStub().GetTxID(),
+    })
+}
+
+// getCorrectionRequest loads the pending correction request for a batch.
+func getCorrectionRequest(ctx contractapi.TransactionContextInterface, batchID string) (*ErrorCorrectionRequest, error) {
+    correctionRequestJSON, err := ctx.GetStub().GetState("CORRECTION_" + batchID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read from world state. %v", err)
+    }
+    if correctionRequestJSON == nil {
+        return nil, fmt.Errorf("correction request for batch %s does not exist", batchID)
+    }
+
+    var correctionRequest ErrorCorrectionRequest
+    if err := json.Unmarshal(correctionRequestJSON, &correctionRequest); err != nil {
+        return nil, err
+    }
+
+    return &correctionRequest, nil
+}
+
+// putCorrectionRequest persists a correction request back to the world
+// state under its "CORRECTION_" key.
+func putCorrectionRequest(ctx contractapi.TransactionContextInterface, correctionRequest *ErrorCorrectionRequest) error {
+    correctionRequestJSON, err := json.Marshal(correctionRequest)
+    if err != nil {
+        return err
+    }
+
+    return ctx.GetStub().PutState("CORRECTION_"+correctionRequest.BatchID, correctionRequestJSON)
+}
+
+// isApproverMSP reports whether mspID is one of the orgs allowed to vote on
+// correction requests via ApproveCorrection.
+func isApproverMSP(mspID string) bool {
+    for _, approver := range approverMSPIDs {
+        if approver == mspID {
+            return true
+        }
+    }
+    return false
+}
+
+// newAuditEntry builds an AuditEntry for the calling identity, stamping it
+// with the transaction's ID and ledger timestamp.
+func newAuditEntry(ctx contractapi.TransactionContextInterface, action string) (AuditEntry, error) {
+    clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return AuditEntry{}, fmt.Errorf("failed to get client MSP ID. %v", err)
+    }
+
+    cert, err := ctx.GetClientIdentity().GetX509Certificate()
+    if err != nil {
+        return AuditEntry{}, fmt.Errorf("failed to get client certificate. %v", err)
+    }
+
+    txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+    if err != nil {
+        return AuditEntry{}, fmt.Errorf("failed to get tx timestamp. %v", err)
+    }
+
+    return AuditEntry{
+        MSPID:     clientMSPID,
+        Identity:  cert.Subject.CommonName,
+        Action:    action,
+        TxID:      ctx.GetStub().GetTxID(),
+        Timestamp: txTimestamp.AsTime().String(),
+    }, nil
+}
+
+// QueryBottlesByBrand returns all batches for the given brand code using a
+// CouchDB rich query. Requires the "brandCode" index in
+// META-INF/statedb/couchdb/indexes to be deployed alongside the chaincode.
+func (s *SmartContract) QueryBottlesByBrand(ctx contractapi.TransactionContextInterface, brandCode string) ([]*BottleData, error) {
+    selector := map[string]interface{}{
+        "selector": map[string]interface{}{
+            "brandCode": brandCode,
+        },
+    }
+
+    queryStringJSON, err := json.Marshal(selector)
+    if err != nil {
+        return nil, err
+    }
+
+    return getQueryResultForQueryString(ctx, string(queryStringJSON))
+}
+
+// QueryBottlesWithErrors returns all batches currently flagged as having an
+// error using a CouchDB rich query. Requires the "error" index in
+// META-INF/statedb/couchdb/indexes to be deployed alongside the chaincode.
+func (s *SmartContract) QueryBottlesWithErrors(ctx contractapi.TransactionContextInterface) ([]*BottleData, error) {
+    queryString := `{"selector":{"error":true}}`
+    return getQueryResultForQueryString(ctx, queryString)
+}
+
+// GetBottlesByRange returns all batches whose key falls within [startKey,
+// endKey). This only works against the world state key range and does not
+// require CouchDB or any index.
+func (s *SmartContract) GetBottlesByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*BottleData, error) {
+    resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get state by range. %v", err)
+    }
+    defer resultsIterator.Close()
+
+    return constructBottlesFromIterator(resultsIterator)
+}
+
+// GetBottlesByRangeWithPagination returns a single page of batches within
+// [startKey, endKey), along with a bookmark that can be passed back in to
+// fetch the next page.
+func (s *SmartContract) GetBottlesByRangeWithPagination(ctx contractapi.TransactionContextInterface, startKey string, endKey string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+    resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get state by range with pagination. %v", err)
+    }
+    defer resultsIterator.Close()
+
+    bottles, err := constructBottlesFromIterator(resultsIterator)
+    if err != nil {
+        return nil, err
+    }
+
+    return &PaginatedQueryResult{
+        Records:             bottles,
+        FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+        Bookmark:            responseMetadata.Bookmark,
+    }, nil
+}
+
+// GetBatchHistory returns the full modification history for a batch, oldest
+// first, by walking GetHistoryForKey.
+func (s *SmartContract) GetBatchHistory(ctx contractapi.TransactionContextInterface, batchID string) ([]*HistoryQueryResult, error) {
+    resultsIterator, err := ctx.GetStub().GetHistoryForKey(batchID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get history for key %s. %v", batchID, err)
+    }
+    defer resultsIterator.Close()
+
+    var records []*HistoryQueryResult
+    for resultsIterator.HasNext() {
+        response, err := resultsIterator.Next()
+        if err != nil {
+            return nil, err
+        }
+
+        var bottle *BottleData
+        if !response.IsDelete {
+            bottle = new(BottleData)
+            if err := json.Unmarshal(response.Value, bottle); err != nil {
+                return nil, err
+            }
+        }
+
+        record := &HistoryQueryResult{
+            Record:    bottle,
+            TxId:      response.TxId,
+            Timestamp: response.Timestamp.AsTime().String(),
+            IsDelete:  response.IsDelete,
+        }
+        records = append(records, record)
+    }
+
+    return records, nil
+}
+
+// getQueryResultForQueryString executes a CouchDB selector query and
+// collects the matching batches.
+func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*BottleData, error) {
+    resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query %s. %v", queryString, err)
+    }
+    defer resultsIterator.Close()
+
+    return constructBottlesFromIterator(resultsIterator)
+}
+
+// constructBottlesFromIterator drains a state query iterator into a slice
+// of BottleData, skipping keys that do not hold batch records (such as
+// "CORRECTION_" prefixed correction requests).
+func constructBottlesFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*BottleData, error) {
+    var bottles []*BottleData
+    for resultsIterator.HasNext() {
+        queryResult, err := resultsIterator.Next()
+        if err != nil {
+            return nil, err
+        }
+
+        var bottle BottleData
+        if err := json.Unmarshal(queryResult.Value, &bottle); err != nil {
+            continue
+        }
+        // Batch records are stored under a key equal to their own BatchID;
+        // anything else (a "CORRECTION_" request, a "bottle" composite
+        // key) may carry the batch's ID in its own batchID field, but is
+        // stored under a different key and must be skipped.
+        if bottle.BatchID != queryResult.Key {
+            continue
+        }
+        bottles = append(bottles, &bottle)
+    }
+
+    return bottles, nil
+}
+
+// MintSerials mints count individual serialized bottles into batchID,
+// numbered startSerial..startSerial+count-1. Each one is stored under the
+// composite key ("bottle", batchID, serial), plus a "SERIAL_" index entry
+// so GetBottleProvenance can find its batch from the serial alone. Serial
+// numbers must be globally unique, as with a real GS1 SGTIN.
+func (s *SmartContract) MintSerials(ctx contractapi.TransactionContextInterface, batchID string, startSerial int, count int) error {
+    batchJSON, err := ctx.GetStub().GetState(batchID)
+    if err != nil {
+        return fmt.Errorf("failed to read from world state. %v", err)
+    }
+    if batchJSON == nil {
+        return fmt.Errorf("batch %s does not exist", batchID)
+    }
+
+    for i := 0; i < count; i++ {
+        serial := formatSerial(startSerial + i)
+
+        key, err := ctx.GetStub().CreateCompositeKey(bottleKeyObjectType, []string{batchID, serial})
+        if err != nil {
+            return fmt.Errorf("failed to create composite key for serial %s. %v", serial, err)
+        }
+
+        existing, err := ctx.GetStub().GetState(key)
+        if err != nil {
+            return fmt.Errorf("failed to read from world state. %v", err)
+        }
+        if existing != nil {
+            return fmt.Errorf("serial %s has already been minted", serial)
+        }
+
+        // The composite-key check above only catches a re-mint into the
+        // same batch; serials must be globally unique (as with a real GS1
+        // SGTIN), so also check the "SERIAL_" index before writing it,
+        // otherwise minting the same serial into a second batch silently
+        // overwrites the first batch's index entry.
+        existingBatchID, err := ctx.GetStub().GetState(serialIndexPrefix + serial)
+        if err != nil {
+            return fmt.Errorf("failed to read serial index. %v", err)
+        }
+        if existingBatchID != nil {
+            return fmt.Errorf("serial %s has already been minted into batch %s", serial, string(existingBatchID))
+        }
+
+        bottleJSON, err := json.Marshal(Bottle{BatchID: batchID, Serial: serial})
+        if err != nil {
+            return err
+        }
+
+        if err := ctx.GetStub().PutState(key, bottleJSON); err != nil {
+            return fmt.Errorf("failed to put to world state. %v", err)
+        }
+
+        if err := ctx.GetStub().PutState(serialIndexPrefix+serial, []byte(batchID)); err != nil {
+            return fmt.Errorf("failed to put serial index. %v", err)
+        }
+    }
+
+    return nil
+}
+
+// TransferSerialRange reassigns ownership of every minted serial in
+// [startSerial, endSerial] within batchID to newOwner. The caller must be
+// the bottle's current Owner (identified by GetClientIdentity().GetID()),
+// or the bottle must be unowned (fresh off MintSerials, Owner == ""): the
+// distributor role gate in accessPolicy only proves the caller belongs to
+// an approved org, not that it holds the specific bottles it is
+// transferring.
+func (s *SmartContract) TransferSerialRange(ctx contractapi.TransactionContextInterface, batchID string, startSerial int, endSerial int, newOwner string) error {
+    callerID, err := ctx.GetClientIdentity().GetID()
+    if err != nil {
+        return fmt.Errorf("failed to get client ID. %v", err)
+    }
+
+    for serialNumber := startSerial; serialNumber <= endSerial; serialNumber++ {
+        serial := formatSerial(serialNumber)
+
+        key, err := ctx.GetStub().CreateCompositeKey(bottleKeyObjectType, []string{batchID, serial})
+        if err != nil {
+            return fmt.Errorf("failed to create composite key for serial %s. %v", serial, err)
+        }
+
+        bottleJSON, err := ctx.GetStub().GetState(key)
+        if err != nil {
+            return fmt.Errorf("failed to read from world state. %v", err)
+        }
+        if bottleJSON == nil {
+            return fmt.Errorf("serial %s in batch %s has not been minted", serial, batchID)
+        }
+
+        var bottle Bottle
+        if err := json.Unmarshal(bottleJSON, &bottle); err != nil {
+            return err
+        }
+        if bottle.Owner != "" && bottle.Owner != callerID {
+            return fmt.Errorf("caller is not the current owner of serial %s", serial)
+        }
+        bottle.Owner = newOwner
+
+        updatedBottleJSON, err := json.Marshal(bottle)
+        if err != nil {
+            return err
+        }
+
+        if err := ctx.GetStub().PutState(key, updatedBottleJSON); err != nil {
+            return fmt.Errorf("failed to put to world state. %v", err)
+        }
+    }
+
+    return nil
+}
+
+// GetBatchSerials returns every bottle minted into batchID. It scans only
+// the composite-key range for this batch (GetStateByPartialCompositeKey),
+// so the cost is O(serials in this batch) rather than O(whole ledger).
+func (s *SmartContract) GetBatchSerials(ctx contractapi.TransactionContextInterface, batchID string) ([]*Bottle, error) {
+    resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bottleKeyObjectType, []string{batchID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to get state by partial composite key. %v", err)
+    }
+    defer resultsIterator.Close()
+
+    var bottles []*Bottle
+    for resultsIterator.HasNext() {
+        queryResult, err := resultsIterator.Next()
+        if err != nil {
+            return nil, err
+        }
+
+        var bottle Bottle
+        if err := json.Unmarshal(queryResult.Value, &bottle); err != nil {
+            return nil, err
+        }
+        bottles = append(bottles, &bottle)
+    }
+
+    return bottles, nil
+}
+
+// GetBottleProvenance returns the full ownership history of a single
+// serialized bottle, oldest first, by resolving its batch from the
+// "SERIAL_" index and walking GetHistoryForKey on its composite key.
+func (s *SmartContract) GetBottleProvenance(ctx contractapi.TransactionContextInterface, serial string) ([]*BottleHistoryQueryResult, error) {
+    batchIDBytes, err := ctx.GetStub().GetState(serialIndexPrefix + serial)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read serial index. %v", err)
+    }
+    if batchIDBytes == nil {
+        return nil, fmt.Errorf("serial %s has not been minted", serial)
+    }
+
+    key, err := ctx.GetStub().CreateCompositeKey(bottleKeyObjectType, []string{string(batchIDBytes), serial})
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key for serial %s. %v", serial, err)
+    }
+
+    resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get history for serial %s. %v", serial, err)
+    }
+    defer resultsIterator.Close()
+
+    var records []*BottleHistoryQueryResult
+    for resultsIterator.HasNext() {
+        response, err := resultsIterator.Next()
+        if err != nil {
+            return nil, err
+        }
+
+        var bottle *Bottle
+        if !response.IsDelete {
+            bottle = new(Bottle)
+            if err := json.Unmarshal(response.Value, bottle); err != nil {
+                return nil, err
+            }
+        }
+
+        records = append(records, &BottleHistoryQueryResult{
+            Record:    bottle,
+            TxId:      response.TxId,
+            Timestamp: response.Timestamp.AsTime().String(),
+            IsDelete:  response.IsDelete,
+        })
+    }
+
+    return records, nil
+}
+
+// formatSerial zero-pads a serial number to serialDigits so that composite
+// keys for a batch sort, and range-scan, in numeric order.
+func formatSerial(serialNumber int) string {
+    return fmt.Sprintf("%0*d", serialDigits, serialNumber)
 }
 
 func main() {
-    chaincode, err := contractapi.NewChaincode(new(SmartContract))
+    sc := new(SmartContract)
+    sc.BeforeTransaction = sc.enforceAccessPolicy
+
+    chaincode, err := contractapi.NewChaincode(sc)
     if err != nil {
         fmt.Printf("Error create alcohol manufacturing chaincode: %s", err.Error())
         return
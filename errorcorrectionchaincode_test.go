@@ -0,0 +1,130 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-chaincode-go/shim"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// fakeStub implements just enough of shim.ChaincodeStubInterface for
+// enforceAccessPolicy to read the called function name.
+type fakeStub struct {
+    shim.ChaincodeStubInterface
+    function string
+}
+
+func (f *fakeStub) GetFunctionAndParameters() (string, []string) {
+    return f.function, nil
+}
+
+// fakeClientIdentity implements just enough of cid.ClientIdentity to drive
+// access.Enforce's role-attribute check.
+type fakeClientIdentity struct {
+    cid.ClientIdentity
+    role    string
+    hasRole bool
+}
+
+func (f *fakeClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+    if attrName != "role" {
+        return "", false, nil
+    }
+    return f.role, f.hasRole, nil
+}
+
+type fakeTransactionContext struct {
+    contractapi.TransactionContextInterface
+    stub           *fakeStub
+    clientIdentity *fakeClientIdentity
+}
+
+func (f *fakeTransactionContext) GetStub() shim.ChaincodeStubInterface {
+    return f.stub
+}
+
+func (f *fakeTransactionContext) GetClientIdentity() cid.ClientIdentity {
+    return f.clientIdentity
+}
+
+// newSmartContract wires up BeforeTransaction exactly as main does. If a
+// future change goes back to a method named BeforeTransaction on
+// SmartContract instead of assigning this field, the assignment below no
+// longer compiles and every test here fails instead of silently passing.
+func newSmartContract() *SmartContract {
+    sc := new(SmartContract)
+    sc.BeforeTransaction = sc.enforceAccessPolicy
+    return sc
+}
+
+// callBeforeTransaction invokes sc's wired-up BeforeTransaction hook.
+// contractapi.Contract.BeforeTransaction is declared as interface{}, so it
+// must be type-asserted back to its handler signature before it can be
+// called directly the way contractapi itself calls it at runtime.
+func callBeforeTransaction(t *testing.T, sc *SmartContract, ctx contractapi.TransactionContextInterface) error {
+    t.Helper()
+
+    handler, ok := sc.BeforeTransaction.(func(contractapi.TransactionContextInterface) error)
+    if !ok {
+        t.Fatalf("SmartContract.BeforeTransaction must be assigned a func(contractapi.TransactionContextInterface) error, got %T", sc.BeforeTransaction)
+    }
+
+    return handler(ctx)
+}
+
+func TestBeforeTransactionIsWiredUp(t *testing.T) {
+    sc := newSmartContract()
+    callBeforeTransaction(t, sc, &fakeTransactionContext{
+        stub:           &fakeStub{function: "GetBatchHistory"},
+        clientIdentity: &fakeClientIdentity{hasRole: false},
+    })
+}
+
+func TestBeforeTransactionRejectsWrongRole(t *testing.T) {
+    sc := newSmartContract()
+    ctx := &fakeTransactionContext{
+        stub:           &fakeStub{function: "RecordError"},
+        clientIdentity: &fakeClientIdentity{role: "excise-officer", hasRole: true},
+    }
+
+    if err := callBeforeTransaction(t, sc, ctx); err == nil {
+        t.Fatal("expected RecordError to be rejected for an excise-officer identity, got nil error")
+    }
+}
+
+func TestBeforeTransactionRejectsMissingAttribute(t *testing.T) {
+    sc := newSmartContract()
+    ctx := &fakeTransactionContext{
+        stub:           &fakeStub{function: "CorrectError"},
+        clientIdentity: &fakeClientIdentity{hasRole: false},
+    }
+
+    if err := callBeforeTransaction(t, sc, ctx); err == nil {
+        t.Fatal("expected CorrectError to be rejected for an identity with no role attribute, got nil error")
+    }
+}
+
+func TestBeforeTransactionAllowsCorrectRole(t *testing.T) {
+    sc := newSmartContract()
+    ctx := &fakeTransactionContext{
+        stub:           &fakeStub{function: "RecordError"},
+        clientIdentity: &fakeClientIdentity{role: "manufacturer", hasRole: true},
+    }
+
+    if err := callBeforeTransaction(t, sc, ctx); err != nil {
+        t.Fatalf("expected RecordError to be allowed for a manufacturer identity, got %v", err)
+    }
+}
+
+func TestBeforeTransactionIgnoresUngatedFunction(t *testing.T) {
+    sc := newSmartContract()
+    ctx := &fakeTransactionContext{
+        stub:           &fakeStub{function: "GetBatchHistory"},
+        clientIdentity: &fakeClientIdentity{hasRole: false},
+    }
+
+    if err := callBeforeTransaction(t, sc, ctx); err != nil {
+        t.Fatalf("expected a function with no accessPolicy entry to be ungated, got %v", err)
+    }
+}